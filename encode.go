@@ -1,12 +1,17 @@
 // Package x264 provides H.264/MPEG-4 AVC codec encoder based on [x264](https://www.videolan.org/developers/x264.html) library.
 package x264
 
+// #include <stdlib.h>
 import "C"
 
 import (
 	"fmt"
 	"image"
 	"io"
+	"runtime"
+	"runtime/cgo"
+	"sort"
+	"unsafe"
 
 	"github.com/piepacker/x264-go/x264c"
 )
@@ -20,6 +25,15 @@ const (
 	LogDebug
 )
 
+// Rate-control method constants, for Options.RateControl. RCUnset (the
+// zero value) leaves whatever the preset/profile already configured.
+const (
+	RCUnset int32 = iota
+	RCCQP
+	RCCRF
+	RCABR
+)
+
 // Options represent encoding options.
 type Options struct {
 	// Frame width.
@@ -34,10 +48,47 @@ type Options struct {
 	Preset string
 	// Profiles: baseline, main, high, high10, high422, high444.
 	Profile string
-	// Log level.
+	// LogLevel filters what reaches Logger, or stderr if Logger is nil.
 	LogLevel int32
-	// CSP
+	// Logger, when set, receives x264's log output via a cgo trampoline
+	// instead of it being written to stderr by the C library.
+	Logger Logger
+	// Csp is the input chroma subsampling (x264c.CspI420/I422/I444/I400).
+	// It drives both the YCbCr buffer layout and, when Profile is left
+	// empty, the profile picked in DefaultParams.
 	Csp int32
+	// BitDepth is the sample bit depth to encode at: 8 or 10. Leaving it
+	// at the zero value behaves as 8. Requesting 10 requires a linked
+	// x264 build that supports it; check BitDepth() first. DefaultParams
+	// does not pick a 10-bit-capable profile for you: baseline/main/high
+	// (DefaultOptions' default) all reject a 10-bit ICsp, so a caller
+	// setting BitDepth to 10 must also set Profile to "high10",
+	// "high422" or "high444" (matching Csp), or clear Profile entirely
+	// to take profileForCsp's pick.
+	BitDepth int
+	// Settings applies arbitrary x264 parameters by key, exactly as
+	// x264_param_parse would (e.g. "crf", "bitrate", "keyint",
+	// "vbv-maxrate", "nal-hrd", "aq-mode", "colorprim", "transfer",
+	// "colormatrix", "range"). Applied after preset/tune but before the
+	// profile is locked in by ParamApplyProfile, so a profile can still
+	// reject settings it's incompatible with.
+	Settings map[string]string
+	// RateControl selects the rate-control method: RCCQP, RCCRF or
+	// RCABR. RCUnset (the default) leaves the preset/profile's choice.
+	RateControl int32
+	// QP is the constant quantizer used when RateControl is RCCQP.
+	QP int
+	// CRF is the target quality used when RateControl is RCCRF.
+	CRF float32
+	// Bitrate is the target average bitrate, in kbps, used when
+	// RateControl is RCABR.
+	Bitrate int
+	// Pass selects two-pass stats handling: 0 (default) disables it, 1
+	// writes StatsFile, 2 reads it, 3 reads then writes it (the middle
+	// pass of a 3+-pass encode).
+	Pass int
+	// StatsFile is the two-pass stats file read and/or written per Pass.
+	StatsFile string
 	// Pts
 	Pts int64
 	// Nals
@@ -60,8 +111,24 @@ type Encoder struct {
 	nals  []*x264c.Nal
 
 	picIn x264c.Picture
+
+	// Pending per-frame overrides, applied by encode() to the next
+	// frame only and then cleared.
+	forceIDR   bool
+	frameQP    int32
+	hasFrameQP bool
+	pendingSei []x264c.SeiPayload
+
+	logHandle cgo.Handle
+
+	// C strings allocated for two-pass stats file paths, freed on Close.
+	statOut, statIn *C.char
 }
 
+// seiUserDataUnregistered is x264's payload type for an unregistered
+// user-data SEI message, as used by AddSEIUserData.
+const seiUserDataUnregistered = 5
+
 func DefaultOptions(width, height, fps int) (*Options, error) {
 	opts := &Options{
 		Width:     width,
@@ -72,6 +139,7 @@ func DefaultOptions(width, height, fps int) (*Options, error) {
 		Profile:   "baseline",
 		LogLevel:  LogInfo,
 		Csp: x264c.CspI420,
+		BitDepth: 8,
 		Pts: 0,
 		Nals: make([]*x264c.Nal, 3),
 	}
@@ -86,7 +154,13 @@ func DefaultOptions(width, height, fps int) (*Options, error) {
 // NOTE: DefaultParams expected that the top level fields of the Options struct (except Param) to be already filled in.
 func DefaultParams(opts *Options) error {
 	param := x264c.Param{}
-	if opts.Preset != "" && opts.Profile != "" {
+
+	profile := opts.Profile
+	if profile == "" {
+		profile = profileForCsp(opts.Csp, opts.BitDepth)
+	}
+
+	if opts.Preset != "" {
 		ret := x264c.ParamDefaultPreset(&param, opts.Preset, opts.Tune)
 		if ret < 0 {
 			return fmt.Errorf("x264: invalid preset/tune name")
@@ -98,7 +172,7 @@ func DefaultParams(opts *Options) error {
 	param.IWidth = int32(opts.Width)
 	param.IHeight = int32(opts.Height)
 
-	param.ICsp = x264c.CspI420
+	param.ICsp = cspWithBitDepth(opts.Csp, opts.BitDepth)
 	param.BVfrInput = 0
 	param.BRepeatHeaders = 1
 	param.BAnnexb = 1
@@ -113,8 +187,47 @@ func DefaultParams(opts *Options) error {
 		param.BIntraRefresh = 1
 	}
 
-	if opts.Profile != "" {
-		ret := x264c.ParamApplyProfile(&param, opts.Profile)
+	switch opts.RateControl {
+	case RCCQP:
+		param.Rc.IRcMethod = x264c.RcCqp
+		param.Rc.IQpConstant = int32(opts.QP)
+	case RCCRF:
+		param.Rc.IRcMethod = x264c.RcCrf
+		param.Rc.FRfConstant = opts.CRF
+	case RCABR:
+		param.Rc.IRcMethod = x264c.RcAbr
+		param.Rc.IBitrate = int32(opts.Bitrate)
+	}
+
+	switch opts.Pass {
+	case 1:
+		param.Rc.BStatWrite = 1
+		param.Rc.PszStatOut = C.CString(opts.StatsFile)
+	case 2:
+		param.Rc.BStatRead = 1
+		param.Rc.PszStatIn = C.CString(opts.StatsFile)
+	case 3:
+		param.Rc.BStatRead = 1
+		param.Rc.BStatWrite = 1
+		param.Rc.PszStatIn = C.CString(opts.StatsFile)
+		param.Rc.PszStatOut = C.CString(opts.StatsFile)
+	}
+
+	keys := make([]string, 0, len(opts.Settings))
+	for k := range opts.Settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ret := x264c.ParamParse(&param, k, opts.Settings[k])
+		if ret < 0 {
+			return fmt.Errorf("x264: invalid setting %q=%q", k, opts.Settings[k])
+		}
+	}
+
+	if profile != "" {
+		ret := x264c.ParamApplyProfile(&param, profile)
 		if ret < 0 {
 			return fmt.Errorf("x264: invalid profile name")
 		}
@@ -123,6 +236,65 @@ func DefaultParams(opts *Options) error {
 	return nil
 }
 
+// profileForCsp returns the x264 profile that matches csp and bitDepth
+// when the caller hasn't picked one explicitly: high444 for 4:4:4,
+// high422 for 4:2:2, high for 8-bit monochrome, and high10 for
+// monochrome or 4:2:0 at more than 8 bits/sample. For 8-bit 4:2:0 it
+// returns "", and DefaultParams then applies no profile.
+func profileForCsp(csp int32, bitDepth int) string {
+	highDepth := bitDepthOrDefault(bitDepth) > 8
+
+	switch csp {
+	case x264c.CspI444:
+		return "high444"
+	case x264c.CspI422:
+		return "high422"
+	case x264c.CspI400:
+		if highDepth {
+			return "high10"
+		}
+		return "high"
+	default: // CspI420
+		if highDepth {
+			return "high10"
+		}
+		return ""
+	}
+}
+
+// bitDepthOrDefault treats the zero value of Options.BitDepth as 8.
+func bitDepthOrDefault(bitDepth int) int {
+	if bitDepth == 0 {
+		return 8
+	}
+	return bitDepth
+}
+
+// cspWithBitDepth ORs x264c.CspHighDepth onto csp when bitDepth requests
+// more than 8 bits/sample. Anything that allocates or configures a
+// picture for this csp (PictureAlloc, param.ICsp) must go through this,
+// or x264 will size its buffers for 8-bit samples while the Go side
+// writes 2 bytes/sample (see YCbCr.CopyToCPointer).
+func cspWithBitDepth(csp int32, bitDepth int) int32 {
+	if bitDepthOrDefault(bitDepth) > 8 {
+		return csp | x264c.CspHighDepth
+	}
+	return csp
+}
+
+// Build returns the build number of the linked x264 library.
+func Build() int32 {
+	return x264c.Build()
+}
+
+// BitDepth returns the bit depth (8 or 10) the linked x264 library was
+// compiled for. Callers must check this returns 10 before setting
+// Options.BitDepth to 10, since a single build of the library only
+// supports one depth.
+func BitDepth() int32 {
+	return x264c.BitDepth()
+}
+
 // NewEncoder returns new x264 encoder.
 func NewEncoder(w io.Writer, opts *Options) (e *Encoder, err error) {
 	e = &Encoder{}
@@ -133,8 +305,14 @@ func NewEncoder(w io.Writer, opts *Options) (e *Encoder, err error) {
 
 	e.csp = opts.Csp
 
+	bitDepth := bitDepthOrDefault(opts.BitDepth)
+	if bitDepth > 8 && BitDepth() != int32(bitDepth) {
+		err = fmt.Errorf("x264: linked library does not support %d-bit encoding", bitDepth)
+		return
+	}
+
 	e.nals = opts.Nals
-	e.img = NewYCbCr(image.Rect(0, 0, e.opts.Width, e.opts.Height))
+	e.img = NewYCbCr(image.Rect(0, 0, e.opts.Width, e.opts.Height), formatForCsp(e.csp), bitDepth)
 
 	if opts.Param != nil {
 		// if param is specified (not nil) then param is used.
@@ -143,11 +321,18 @@ func NewEncoder(w io.Writer, opts *Options) (e *Encoder, err error) {
 		if err != nil {
 			return
 		}
+
+		// Only the C strings allocated by this DefaultParams call are
+		// freed on Close. A caller-supplied Param (the branch above),
+		// including one built earlier by DefaultOptions or DefaultParams,
+		// keeps its PszStatOut/PszStatIn, and Close does not free them.
+		e.statOut = opts.Param.Rc.PszStatOut
+		e.statIn = opts.Param.Rc.PszStatIn
 	}
 
 	// Allocate on create instead while encoding
 	var picIn x264c.Picture
-	ret := x264c.PictureAlloc(&picIn, e.csp, int32(e.opts.Width), int32(e.opts.Height))
+	ret := x264c.PictureAlloc(&picIn, cspWithBitDepth(e.csp, opts.BitDepth), int32(e.opts.Width), int32(e.opts.Height))
 	if ret < 0 {
 		err = fmt.Errorf("x264: cannot allocate picture")
 		return
@@ -157,9 +342,14 @@ func NewEncoder(w io.Writer, opts *Options) (e *Encoder, err error) {
 		// Cleanup if intialization fail
 		if err != nil {
 			x264c.PictureClean(&picIn)
+			if e.logHandle != 0 {
+				e.logHandle.Delete()
+			}
 		}
 	}()
 
+	e.logHandle = installLogger(opts.Param, opts.Logger)
+
 	e.e = x264c.EncoderOpen(opts.Param)
 	if e.e == nil {
 		err = fmt.Errorf("x264: cannot open the encoder")
@@ -190,8 +380,6 @@ func NewEncoder(w io.Writer, opts *Options) (e *Encoder, err error) {
 
 // Encode encodes image.
 func (e *Encoder) Encode(im image.Image) (err error) {
-	var picOut x264c.Picture
-
 	e.img.ToYCbCr(im)
 
 	picIn := e.picIn
@@ -199,7 +387,139 @@ func (e *Encoder) Encode(im image.Image) (err error) {
 	picIn.IPts = e.pts
 	e.pts++
 
-	ret := x264c.EncoderEncode(e.e, e.nals, &e.nnals, &picIn, &picOut)
+	return e.encode(&picIn)
+}
+
+// EncodeYCbCr encodes a frame directly from the caller's YUV planes,
+// bypassing the Encode's YCbCr conversion and CopyToCPointer memcpy.
+// The planes are wired straight into the picture x264 encodes, so y, cb
+// and cr must already be laid out for the encoder's configured
+// colorspace (opts.Csp); strides holds the per-plane byte stride in the
+// same [Y, Cb, Cr] order. y, cb and cr are pinned with a runtime.Pinner
+// for the duration of the underlying C call, satisfying cgo's rule that
+// Go memory passed to C must not move or be collected; ordinary
+// Go-allocated YUV buffers (e.g. from a hardware decoder or emulator)
+// are safe to pass here.
+func (e *Encoder) EncodeYCbCr(y, cb, cr []byte, strides [3]int) (err error) {
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+
+	var planes [3]unsafe.Pointer
+	if len(y) > 0 {
+		pinner.Pin(&y[0])
+		planes[0] = unsafe.Pointer(&y[0])
+	}
+	if len(cb) > 0 {
+		pinner.Pin(&cb[0])
+		planes[1] = unsafe.Pointer(&cb[0])
+	}
+	if len(cr) > 0 {
+		pinner.Pin(&cr[0])
+		planes[2] = unsafe.Pointer(&cr[0])
+	}
+
+	return e.encodeRaw(planes, strides)
+}
+
+// EncodeRaw encodes a frame from raw plane pointers, with no copy and no
+// pinning. Unlike EncodeYCbCr, planes must already point into memory
+// that isn't managed by the Go runtime (e.g. a C.malloc'd buffer from a
+// hardware decoder) — passing pointers into Go-allocated slices here
+// violates cgo's Go-pointer rule, since nothing pins them against the
+// GC for the call. It is the caller's responsibility to keep that
+// memory alive and unmoved for the duration of the call.
+func (e *Encoder) EncodeRaw(planes [3]unsafe.Pointer, strides [3]int) (err error) {
+	return e.encodeRaw(planes, strides)
+}
+
+func (e *Encoder) encodeRaw(planes [3]unsafe.Pointer, strides [3]int) (err error) {
+	picIn := e.picIn
+	picIn.Img.Plane[0] = planes[0]
+	picIn.Img.Plane[1] = planes[1]
+	picIn.Img.Plane[2] = planes[2]
+	picIn.Img.IStride[0] = int32(strides[0])
+	picIn.Img.IStride[1] = int32(strides[1])
+	picIn.Img.IStride[2] = int32(strides[2])
+	picIn.IPts = e.pts
+	e.pts++
+
+	return e.encode(&picIn)
+}
+
+// ForceKeyframe requests that the next Encode/EncodeYCbCr/EncodeRaw call
+// produce an IDR frame, regardless of the configured keyframe interval.
+// Useful for interactive streaming, where a client signals packet loss
+// and needs a fresh decode point on demand.
+func (e *Encoder) ForceKeyframe() {
+	e.forceIDR = true
+}
+
+// SetFrameQP overrides the quantizer for the next encoded frame only,
+// including an explicit QP of 0 (lossless). Simply don't call it to
+// leave the rate controller's own choice in place.
+func (e *Encoder) SetFrameQP(qp int) {
+	e.frameQP = int32(qp)
+	e.hasFrameQP = true
+}
+
+// AddSEIUserData appends an unregistered user-data SEI message (payload
+// type 5) to the next encoded frame, built from uuid and payload. The
+// payload is copied into C-allocated memory, since it's handed to x264
+// via picIn.ExtraSei, and freed once that frame has been encoded. This
+// is how out-of-band metadata, such as capture timestamps or input
+// latency markers, gets muxed into the elementary stream for
+// interactive streaming.
+func (e *Encoder) AddSEIUserData(uuid [16]byte, payload []byte) {
+	buf := make([]byte, 16+len(payload))
+	copy(buf, uuid[:])
+	copy(buf[16:], payload)
+
+	e.pendingSei = append(e.pendingSei, x264c.SeiPayload{
+		PayloadType: seiUserDataUnregistered,
+		PayloadSize: int32(len(buf)),
+		Payload:     C.CBytes(buf),
+	})
+}
+
+// encode runs picIn through the x264 encoder and writes out any payload
+// it produces.
+func (e *Encoder) encode(picIn *x264c.Picture) (err error) {
+	var picOut x264c.Picture
+
+	if e.forceIDR {
+		picIn.IType = x264c.TypeIDR
+		e.forceIDR = false
+	}
+
+	if e.hasFrameQP {
+		picIn.IQpplus1 = e.frameQP + 1
+		e.hasFrameQP = false
+	}
+
+	if len(e.pendingSei) > 0 {
+		// e.pendingSei's backing array is Go memory, and EncoderEncode
+		// below reads it from C through picIn.ExtraSei.Payloads, so it
+		// must be pinned for the call's duration the same way
+		// EncodeYCbCr pins y/cb/cr — each Payload field inside it is
+		// already C-allocated (AddSEIUserData), but the SeiPayload
+		// array itself is not.
+		var pinner runtime.Pinner
+		pinner.Pin(&e.pendingSei[0])
+		defer pinner.Unpin()
+
+		picIn.ExtraSei.Payloads = &e.pendingSei[0]
+		picIn.ExtraSei.NumPayloads = int32(len(e.pendingSei))
+
+		pending := e.pendingSei
+		defer func() {
+			for _, p := range pending {
+				C.free(p.Payload)
+			}
+			e.pendingSei = nil
+		}()
+	}
+
+	ret := x264c.EncoderEncode(e.e, e.nals, &e.nnals, picIn, &picOut)
 	if ret < 0 {
 		err = fmt.Errorf("x264: cannot encode picture")
 		return
@@ -256,5 +576,14 @@ func (e *Encoder) Close() error {
 	picIn := e.picIn
 	x264c.PictureClean(&picIn)
 	x264c.EncoderClose(e.e)
+	if e.logHandle != 0 {
+		e.logHandle.Delete()
+	}
+	if e.statOut != nil {
+		C.free(unsafe.Pointer(e.statOut))
+	}
+	if e.statIn != nil {
+		C.free(unsafe.Pointer(e.statIn))
+	}
 	return nil
 }
\ No newline at end of file
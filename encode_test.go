@@ -0,0 +1,75 @@
+package x264
+
+import (
+	"testing"
+
+	"github.com/piepacker/x264-go/x264c"
+)
+
+func TestBitDepthOrDefault(t *testing.T) {
+	cases := []struct {
+		name     string
+		bitDepth int
+		want     int
+	}{
+		{"zero-value-defaults-to-8", 0, 8},
+		{"explicit-8", 8, 8},
+		{"explicit-10", 10, 10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := bitDepthOrDefault(c.bitDepth); got != c.want {
+				t.Errorf("bitDepthOrDefault(%d) = %d, want %d", c.bitDepth, got, c.want)
+			}
+		})
+	}
+}
+
+func TestCspWithBitDepth(t *testing.T) {
+	cases := []struct {
+		name     string
+		csp      int32
+		bitDepth int
+		want     int32
+	}{
+		{"8bit-unchanged", x264c.CspI420, 8, x264c.CspI420},
+		{"zero-value-unchanged", x264c.CspI420, 0, x264c.CspI420},
+		{"10bit-ors-high-depth", x264c.CspI420, 10, x264c.CspI420 | x264c.CspHighDepth},
+		{"10bit-i444-ors-high-depth", x264c.CspI444, 10, x264c.CspI444 | x264c.CspHighDepth},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := cspWithBitDepth(c.csp, c.bitDepth); got != c.want {
+				t.Errorf("cspWithBitDepth(%v, %d) = %v, want %v", c.csp, c.bitDepth, got, c.want)
+			}
+		})
+	}
+}
+
+func TestProfileForCsp(t *testing.T) {
+	cases := []struct {
+		name     string
+		csp      int32
+		bitDepth int
+		want     string
+	}{
+		{"i420-8bit-defers-to-caller", x264c.CspI420, 8, ""},
+		{"i420-zero-value-defers-to-caller", x264c.CspI420, 0, ""},
+		{"i420-10bit-needs-high10", x264c.CspI420, 10, "high10"},
+		{"i422-8bit", x264c.CspI422, 8, "high422"},
+		{"i422-10bit-still-high422", x264c.CspI422, 10, "high422"},
+		{"i444-8bit", x264c.CspI444, 8, "high444"},
+		{"i400-8bit", x264c.CspI400, 8, "high"},
+		{"i400-10bit-needs-high10", x264c.CspI400, 10, "high10"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := profileForCsp(c.csp, c.bitDepth); got != c.want {
+				t.Errorf("profileForCsp(%v, %d) = %q, want %q", c.csp, c.bitDepth, got, c.want)
+			}
+		})
+	}
+}
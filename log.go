@@ -0,0 +1,49 @@
+package x264
+
+/*
+#include <stdarg.h>
+#include <stdio.h>
+#include "_cgo_export.h"
+
+static void x264goLogTrampoline(void *data, int level, const char *fmt, va_list args) {
+	char buf[1024];
+	vsnprintf(buf, sizeof(buf), fmt, args);
+	x264goDispatchLog(data, level, buf);
+}
+*/
+import "C"
+
+import (
+	"runtime/cgo"
+	"unsafe"
+
+	"github.com/piepacker/x264-go/x264c"
+)
+
+// Logger receives a single formatted log line from the x264 library, at
+// the severity reported by level (see the Log* constants).
+type Logger func(level int32, line string)
+
+//export x264goDispatchLog
+func x264goDispatchLog(data unsafe.Pointer, level C.int, msg *C.char) {
+	logger, ok := cgo.Handle(uintptr(data)).Value().(Logger)
+	if !ok {
+		return
+	}
+	logger(int32(level), C.GoString(msg))
+}
+
+// installLogger wires logger into param via the cgo trampoline above,
+// in place of x264's default stderr logging. The returned handle must
+// be deleted (Encoder.Close does this) once the encoder is done with
+// param; a zero Handle means no logger was installed.
+func installLogger(param *x264c.Param, logger Logger) cgo.Handle {
+	if logger == nil {
+		return 0
+	}
+
+	h := cgo.NewHandle(logger)
+	param.PfLog = C.x264goLogTrampoline
+	param.PLogPrivate = unsafe.Pointer(uintptr(h))
+	return h
+}
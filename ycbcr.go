@@ -0,0 +1,161 @@
+package x264
+
+// #include <string.h>
+import "C"
+
+import (
+	"image"
+	"image/color"
+	"unsafe"
+
+	"github.com/piepacker/x264-go/x264c"
+)
+
+// YCbCrFormat identifies the chroma subsampling of a YCbCr buffer.
+type YCbCrFormat int32
+
+// Supported chroma subsampling formats.
+const (
+	FormatI420 YCbCrFormat = iota
+	FormatI422
+	FormatI444
+	FormatI400
+)
+
+// formatForCsp returns the YCbCrFormat matching an x264c colorspace
+// constant, defaulting to 4:2:0 for anything it doesn't recognize.
+func formatForCsp(csp int32) YCbCrFormat {
+	switch csp {
+	case x264c.CspI422:
+		return FormatI422
+	case x264c.CspI444:
+		return FormatI444
+	case x264c.CspI400:
+		return FormatI400
+	default:
+		return FormatI420
+	}
+}
+
+// YCbCr is a chroma-subsampled image buffer, laid out the way x264
+// expects its planar YUV input: a full-resolution Y plane followed,
+// except in the monochrome case, by Cb and Cr planes sized according to
+// Format. Samples are 1 byte wide at BitDepth 8 and 2 bytes wide
+// (little-endian) at BitDepth 10.
+type YCbCr struct {
+	Format   YCbCrFormat
+	BitDepth int
+
+	Y, Cb, Cr []byte
+
+	YStride int // samples per row, not bytes
+	CStride int // samples per row, not bytes
+
+	Rect image.Rectangle
+}
+
+// bytesPerSample returns how many bytes a single YCbCr sample occupies
+// at the given bit depth.
+func bytesPerSample(bitDepth int) int {
+	if bitDepth > 8 {
+		return 2
+	}
+	return 1
+}
+
+// NewYCbCr returns a new YCbCr buffer sized for r in the given format
+// and bit depth (8 or 10).
+func NewYCbCr(r image.Rectangle, format YCbCrFormat, bitDepth int) *YCbCr {
+	w, h := r.Dx(), r.Dy()
+	bps := bytesPerSample(bitDepth)
+
+	p := &YCbCr{
+		Format:   format,
+		BitDepth: bitDepth,
+		Y:        make([]byte, w*h*bps),
+		YStride:  w,
+		Rect:     r,
+	}
+
+	switch format {
+	case FormatI422:
+		p.CStride = (w + 1) / 2
+		p.Cb = make([]byte, p.CStride*h*bps)
+		p.Cr = make([]byte, p.CStride*h*bps)
+	case FormatI444:
+		p.CStride = w
+		p.Cb = make([]byte, p.CStride*h*bps)
+		p.Cr = make([]byte, p.CStride*h*bps)
+	case FormatI400:
+		// Monochrome: no chroma planes.
+	default: // FormatI420
+		p.CStride = (w + 1) / 2
+		ch := (h + 1) / 2
+		p.Cb = make([]byte, p.CStride*ch*bps)
+		p.Cr = make([]byte, p.CStride*ch*bps)
+	}
+
+	return p
+}
+
+// putSample writes v, an 8-bit sample, into buf at sample index idx,
+// widening it to the buffer's configured bit depth.
+func (p *YCbCr) putSample(buf []byte, idx int, v uint8) {
+	if p.BitDepth <= 8 {
+		buf[idx] = v
+		return
+	}
+
+	v16 := uint16(v) << (uint(p.BitDepth) - 8)
+	o := idx * 2
+	buf[o] = byte(v16)
+	buf[o+1] = byte(v16 >> 8)
+}
+
+// ToYCbCr converts im into the receiver's planes.
+func (p *YCbCr) ToYCbCr(im image.Image) {
+	b := im.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := im.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+
+			p.putSample(p.Y, y*p.YStride+x, yy)
+
+			switch p.Format {
+			case FormatI400:
+				// No chroma to fill in.
+			case FormatI444:
+				p.putSample(p.Cb, y*p.CStride+x, cb)
+				p.putSample(p.Cr, y*p.CStride+x, cr)
+			case FormatI422:
+				if x%2 == 0 {
+					p.putSample(p.Cb, y*p.CStride+x/2, cb)
+					p.putSample(p.Cr, y*p.CStride+x/2, cr)
+				}
+			default: // FormatI420
+				if x%2 == 0 && y%2 == 0 {
+					cx, cy := x/2, y/2
+					p.putSample(p.Cb, cy*p.CStride+cx, cb)
+					p.putSample(p.Cr, cy*p.CStride+cx, cr)
+				}
+			}
+		}
+	}
+}
+
+// CopyToCPointer copies the Y, Cb and Cr planes into the C-allocated
+// buffers pointed to by y, cb and cr. Plane lengths already account for
+// BitDepth (2 bytes/sample above 8-bit), so the copy sizes are correct
+// for either depth. cb and cr are ignored for monochrome (FormatI400)
+// buffers.
+func (p *YCbCr) CopyToCPointer(y, cb, cr unsafe.Pointer) {
+	C.memcpy(y, unsafe.Pointer(&p.Y[0]), C.size_t(len(p.Y)))
+	if p.Format == FormatI400 {
+		return
+	}
+	C.memcpy(cb, unsafe.Pointer(&p.Cb[0]), C.size_t(len(p.Cb)))
+	C.memcpy(cr, unsafe.Pointer(&p.Cr[0]), C.size_t(len(p.Cr)))
+}
@@ -0,0 +1,104 @@
+package x264
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNewYCbCrPlaneSizes(t *testing.T) {
+	cases := []struct {
+		name        string
+		format      YCbCrFormat
+		bitDepth    int
+		width       int
+		height      int
+		wantYLen    int
+		wantCStride int
+		wantCLen    int
+	}{
+		{"i420-8bit", FormatI420, 8, 4, 4, 16, 2, 4},
+		{"i420-10bit", FormatI420, 10, 4, 4, 32, 2, 8},
+		{"i420-odd-dimensions", FormatI420, 8, 3, 3, 9, 2, 4},
+		{"i422-8bit", FormatI422, 8, 4, 4, 16, 2, 8},
+		{"i444-8bit", FormatI444, 8, 4, 4, 16, 4, 16},
+		{"i400-8bit", FormatI400, 8, 4, 4, 16, 0, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := NewYCbCr(image.Rect(0, 0, c.width, c.height), c.format, c.bitDepth)
+
+			if len(p.Y) != c.wantYLen {
+				t.Errorf("len(Y) = %d, want %d", len(p.Y), c.wantYLen)
+			}
+			if p.CStride != c.wantCStride {
+				t.Errorf("CStride = %d, want %d", p.CStride, c.wantCStride)
+			}
+			if len(p.Cb) != c.wantCLen {
+				t.Errorf("len(Cb) = %d, want %d", len(p.Cb), c.wantCLen)
+			}
+			if len(p.Cr) != c.wantCLen {
+				t.Errorf("len(Cr) = %d, want %d", len(p.Cr), c.wantCLen)
+			}
+		})
+	}
+}
+
+func TestPutSampleWidening(t *testing.T) {
+	p8 := &YCbCr{BitDepth: 8}
+	buf8 := make([]byte, 1)
+	p8.putSample(buf8, 0, 0xAB)
+	if buf8[0] != 0xAB {
+		t.Errorf("8-bit sample = %#x, want 0xab", buf8[0])
+	}
+
+	p10 := &YCbCr{BitDepth: 10}
+	buf10 := make([]byte, 2)
+	p10.putSample(buf10, 0, 0xFF)
+	got := uint16(buf10[0]) | uint16(buf10[1])<<8
+	if want := uint16(0xFF) << 2; got != want {
+		t.Errorf("10-bit sample = %#x, want %#x", got, want)
+	}
+}
+
+func TestToYCbCrMonochromeHasNoChroma(t *testing.T) {
+	im := image.NewGray(image.Rect(0, 0, 2, 2))
+	p := NewYCbCr(im.Bounds(), FormatI400, 8)
+	p.ToYCbCr(im)
+
+	if len(p.Cb) != 0 || len(p.Cr) != 0 {
+		t.Errorf("FormatI400 buffer has chroma: len(Cb)=%d len(Cr)=%d", len(p.Cb), len(p.Cr))
+	}
+}
+
+func TestToYCbCrI444FillsEverySample(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			im.Set(x, y, color.White)
+		}
+	}
+
+	p := NewYCbCr(im.Bounds(), FormatI444, 8)
+	p.ToYCbCr(im)
+
+	for i := range p.Cb {
+		if p.Cb[i] == 0 && p.Cr[i] == 0 {
+			t.Fatalf("Cb/Cr[%d] left unset for a full-chroma format", i)
+		}
+	}
+}
+
+func TestToYCbCrI422SharesChromaAcrossPairedColumns(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	im.Set(0, 0, color.White)
+	im.Set(1, 0, color.White)
+
+	p := NewYCbCr(im.Bounds(), FormatI422, 8)
+	p.ToYCbCr(im)
+
+	if len(p.Cb) != 1 || len(p.Cr) != 1 {
+		t.Fatalf("2-wide 4:2:2 row should produce 1 chroma sample, got len(Cb)=%d len(Cr)=%d", len(p.Cb), len(p.Cr))
+	}
+}